@@ -1,4 +1,4 @@
-// Public Domain (-) 2010-2011 The Golly Authors.
+// Public Domain (-) 2010-2013 The Golly Authors.
 // See the Golly UNLICENSE file for details.
 
 // Package command provides utility functions for executing system commands.
@@ -6,53 +6,140 @@ package command
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os"
+	"os/exec"
+	"time"
 )
 
+// CommandError is returned when a command could not be started or its output
+// could not be collected.
 type CommandError struct {
 	Command string
 	Args    []string
+	Err     error
 }
 
 func (err *CommandError) Error() string {
-	return fmt.Sprintf("Couldn't successfully execute: %s %v", err.Command, err.Args)
+	return fmt.Sprintf("Couldn't successfully execute: %s %v: %s", err.Command, err.Args, err.Err)
 }
 
-// GetOutput returns the output from running the given command arguments.
-func GetOutput(args []string) (output string, error error) {
-	var (
-		buffer  *bytes.Buffer
-		process *os.Process
-	)
-	read_pipe, write_pipe, err := os.Pipe()
-	if err != nil {
-		goto Error
-	}
-	defer read_pipe.Close()
-	process, err = os.StartProcess(args[0], args,
-		&os.ProcAttr{
-			Dir:   ".",
-			Env:   os.Environ(),
-			Files: []*os.File{nil, write_pipe, nil},
-		})
-	if err != nil {
-		write_pipe.Close()
-		goto Error
+// ExitError is returned when a command runs to completion but exits with a
+// non-zero status. It carries the captured stderr so callers don't have to
+// thread their own buffer through just to get a useful error message.
+type ExitError struct {
+	Command string
+	Args    []string
+	Code    int
+	Stderr  string
+}
+
+func (err *ExitError) Error() string {
+	return fmt.Sprintf("%s %v: exit status %d: %s", err.Command, err.Args, err.Code, err.Stderr)
+}
+
+// Result holds the captured output of a command that was run to completion.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Cmd describes a command to be run. It wraps os/exec and adds the bits that
+// GetOutput used to get wrong: a real stdin, environment/directory overrides
+// and an optional timeout.
+type Cmd struct {
+	Args    []string
+	Stdin   io.Reader
+	Env     []string
+	Dir     string
+	Timeout time.Duration
+
+	// Stdout and Stderr, if set, additionally receive a live copy of the
+	// command's output as it's produced -- useful for callers that want to
+	// stream output while it's still buffered up for the returned Result.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run executes the command and blocks until it completes, ctx is cancelled,
+// or the configured Timeout elapses -- whichever happens first. It returns
+// the captured stdout/stderr even when the command exits with an error, so
+// callers can inspect what went wrong.
+func (c *Cmd) Run(ctx context.Context) (*Result, error) {
+	if len(c.Args) == 0 {
+		return nil, &CommandError{Err: fmt.Errorf("no command arguments given")}
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	// Deliberately not exec.CommandContext: its Wait() reports ctx's error
+	// only when killing the process leaves it exiting with status 0, which
+	// is never true for the ordinary SIGKILL case -- a genuinely killed
+	// process instead comes back as a plain *exec.ExitError, indistinguishable
+	// from one that happened to exit with the same status on its own. Waiting
+	// for the process ourselves and selecting on ctx.Done() lets us tell the
+	// two apart unambiguously, without polling ctx.Err() after the fact, which
+	// would wrongly flag commands that finished on their own just as a
+	// subsequently-irrelevant deadline happened to pass.
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Dir = c.Dir
+	cmd.Env = c.Env
+	cmd.Stdin = c.Stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if c.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, c.Stdout)
+	}
+	if c.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, c.Stderr)
+	}
+	result := &Result{}
+	if err := cmd.Start(); err != nil {
+		return result, &CommandError{Command: c.Args[0], Args: c.Args, Err: err}
+	}
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-waitErr:
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-waitErr
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+		return result, ctx.Err()
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+		return result, &ExitError{
+			Command: c.Args[0],
+			Args:    c.Args,
+			Code:    result.ExitCode,
+			Stderr:  result.Stderr,
+		}
 	}
-	_, err = process.Wait()
-	write_pipe.Close()
 	if err != nil {
-		goto Error
+		return result, &CommandError{Command: c.Args[0], Args: c.Args, Err: err}
 	}
-	buffer = &bytes.Buffer{}
-	_, err = io.Copy(buffer, read_pipe)
+	return result, nil
+}
+
+// GetOutput returns the output from running the given command arguments. It
+// is kept around as a thin wrapper over Cmd for backward compatibility --
+// unlike the old implementation, it now actually propagates non-zero exit
+// statuses via an *ExitError.
+func GetOutput(args []string) (output string, err error) {
+	cmd := &Cmd{Args: args}
+	result, err := cmd.Run(context.Background())
 	if err != nil {
-		goto Error
+		return "", err
 	}
-	output = buffer.String()
-	return output, nil
-Error:
-	return "", &CommandError{args[0], args}
+	return result.Stdout, nil
 }
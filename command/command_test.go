@@ -0,0 +1,119 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmdRunCapturesOutput(t *testing.T) {
+	cmd := &Cmd{Args: []string{"/bin/sh", "-c", "echo out; echo err 1>&2"}}
+	result, err := cmd.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned unexpected error: %s", err)
+	}
+	if result.Stdout != "out\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "out\n")
+	}
+	if result.Stderr != "err\n" {
+		t.Errorf("Stderr = %q, want %q", result.Stderr, "err\n")
+	}
+}
+
+func TestCmdRunExitError(t *testing.T) {
+	cmd := &Cmd{Args: []string{"/bin/sh", "-c", "echo oops 1>&2; exit 3"}}
+	_, err := cmd.Run(context.Background())
+	exitErr, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("err = %#v (%T), want *ExitError", err, err)
+	}
+	if exitErr.Code != 3 {
+		t.Errorf("Code = %d, want 3", exitErr.Code)
+	}
+	if !strings.Contains(exitErr.Stderr, "oops") {
+		t.Errorf("Stderr = %q, want it to contain %q", exitErr.Stderr, "oops")
+	}
+}
+
+func TestCmdRunStdin(t *testing.T) {
+	cmd := &Cmd{
+		Args:  []string{"/bin/cat"},
+		Stdin: strings.NewReader("hello"),
+	}
+	result, err := cmd.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned unexpected error: %s", err)
+	}
+	if result.Stdout != "hello" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "hello")
+	}
+}
+
+func TestCmdRunEnv(t *testing.T) {
+	cmd := &Cmd{
+		Args: []string{"/bin/sh", "-c", "echo $GOLLY_TEST_VAR"},
+		Env:  []string{"GOLLY_TEST_VAR=set"},
+	}
+	result, err := cmd.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned unexpected error: %s", err)
+	}
+	if result.Stdout != "set\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "set\n")
+	}
+}
+
+func TestCmdRunTimeout(t *testing.T) {
+	cmd := &Cmd{
+		Args:    []string{"/bin/sleep", "2"},
+		Timeout: 100 * time.Millisecond,
+	}
+	_, err := cmd.Run(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %#v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCmdRunSucceedsNearTimeoutBoundary(t *testing.T) {
+	cmd := &Cmd{
+		Args:    []string{"/bin/sh", "-c", "exit 0"},
+		Timeout: 50 * time.Millisecond,
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := cmd.Run(context.Background()); err != nil {
+			t.Fatalf("Run returned unexpected error: %s", err)
+		}
+	}
+}
+
+func TestCmdRunCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := &Cmd{Args: []string{"/bin/sleep", "2"}}
+	_, err := cmd.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %#v, want context.Canceled", err)
+	}
+}
+
+func TestGetOutput(t *testing.T) {
+	output, err := GetOutput([]string{"/bin/echo", "hi"})
+	if err != nil {
+		t.Fatalf("GetOutput returned unexpected error: %s", err)
+	}
+	if output != "hi\n" {
+		t.Errorf("output = %q, want %q", output, "hi\n")
+	}
+}
+
+func TestGetOutputExitError(t *testing.T) {
+	_, err := GetOutput([]string{"/bin/sh", "-c", "exit 1"})
+	if _, ok := err.(*ExitError); !ok {
+		t.Fatalf("err = %#v (%T), want *ExitError", err, err)
+	}
+}
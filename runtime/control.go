@@ -0,0 +1,245 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+package runtime
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/tav/golly/command"
+	"github.com/tav/golly/log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBroadcast fans out the process's own log-worthy activity -- errors
+// reported via Error/StandardError, signals dispatched via the control
+// server, commands launched via /exec -- to any active /tail subscribers.
+// It's a package-level singleton rather than a field on ControlServer so
+// that Error/StandardError, which have no reference to a server instance,
+// can publish to it too.
+var logBroadcast = newLogHub()
+
+// ControlServer exposes a small, bearer-token-guarded HTTP API for operating
+// a running golly process remotely -- launching commands, tailing its log,
+// checking on its health and signalling or halting it -- without needing
+// SSH access to the host. It's modelled on the buildlet control protocol
+// that the Go project uses to drive its build machines.
+type ControlServer struct {
+	Addr   string
+	Secret string
+
+	startTime time.Time
+}
+
+// NewControlServer creates a ControlServer bound to addr and guarded by the
+// given bearer token. Call Serve to start handling requests.
+func NewControlServer(addr, secret string) *ControlServer {
+	return &ControlServer{
+		Addr:      addr,
+		Secret:    secret,
+		startTime: time.Now(),
+	}
+}
+
+// Serve starts the control server in the background, logging and giving up
+// if it can't bind its listening address.
+func (c *ControlServer) Serve() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/exec", c.authenticated(c.handleExec))
+	mux.HandleFunc("/halt", c.authenticated(c.handleHalt))
+	mux.HandleFunc("/tail", c.authenticated(c.handleTail))
+	mux.HandleFunc("/status", c.authenticated(c.handleStatus))
+	mux.HandleFunc("/signal", c.authenticated(c.handleSignal))
+	go func() {
+		if err := http.ListenAndServe(c.Addr, mux); err != nil {
+			log.Error("Control server on %s stopped: %s", c.Addr, err)
+		}
+	}()
+}
+
+// authenticated wraps handler so that it's only called once the request
+// carries a valid ``Authorization: Bearer <secret>`` header.
+func (c *ControlServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+		given := r.Header.Get("Authorization")
+		// Use a constant-time comparison -- this guards a literal
+		// remote-code-execution endpoint, so a timing side-channel on the
+		// token check is worth avoiding.
+		if c.Secret == "" || !strings.HasPrefix(given, prefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(given, prefix)), []byte(c.Secret)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleExec launches a subprocess using the command package and streams
+// its combined stdout/stderr back over chunked HTTP as it's produced.
+func (c *ControlServer) handleExec(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Args    []string `json:"args"`
+		Env     []string `json:"env"`
+		Dir     string   `json:"dir"`
+		Timeout int      `json:"timeout"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Args) == 0 {
+		http.Error(w, "missing args", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	out := flushWriter{w: w}
+	logBroadcast.Publish(fmt.Sprintf("exec: %v", req.Args))
+	cmd := &command.Cmd{
+		Args:    req.Args,
+		Env:     req.Env,
+		Dir:     req.Dir,
+		Timeout: time.Duration(req.Timeout) * time.Second,
+		Stdout:  out,
+		Stderr:  out,
+	}
+	if _, err := cmd.Run(r.Context()); err != nil {
+		fmt.Fprintf(out, "\n-- %s\n", err)
+	}
+}
+
+// handleHalt terminates the process via Exit(0). It replies before halting
+// so the caller gets a response.
+func (c *ControlServer) handleHalt(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "halting")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		Exit(0)
+	}()
+}
+
+// handleTail subscribes the caller to the live log stream until it
+// disconnects or the process halts.
+func (c *ControlServer) handleTail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := logBroadcast.Subscribe()
+	defer logBroadcast.Unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	for {
+		select {
+		case line, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintln(w, line)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleStatus reports basic health information about the process.
+func (c *ControlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Pid        int    `json:"pid"`
+		Uptime     string `json:"uptime"`
+		Goroutines int    `json:"goroutines"`
+		MemAlloc   uint64 `json:"mem_alloc"`
+	}{
+		Pid:        os.Getpid(),
+		Uptime:     time.Since(c.startTime).String(),
+		Goroutines: runtime.NumGoroutine(),
+		MemAlloc:   mem.Alloc,
+	})
+}
+
+// handleSignal dispatches into the registered SignalHandlers, matching by
+// the signal's string representation (e.g. "interrupt", "terminated") so
+// that it works the same regardless of platform.
+func (c *ControlServer) handleSignal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Signal string `json:"signal"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for sig, handler := range SignalHandlers {
+		if strings.EqualFold(sig.String(), req.Signal) {
+			logBroadcast.Publish(fmt.Sprintf("signal: %s", sig))
+			go handler()
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("no handler registered for signal %q", req.Signal), http.StatusNotFound)
+}
+
+// flushWriter wraps an http.ResponseWriter so that every write is flushed
+// straight through to the client, turning the response into a live stream.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if flusher, ok := fw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// logHub is a minimal pub-sub broadcaster used to back the /tail endpoint.
+type logHub struct {
+	mu   sync.Mutex
+	subs map[chan string]bool
+}
+
+func newLogHub() *logHub {
+	return &logHub{subs: make(map[chan string]bool)}
+}
+
+func (h *logHub) Subscribe() chan string {
+	ch := make(chan string, 100)
+	h.mu.Lock()
+	h.subs[ch] = true
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *logHub) Unsubscribe(ch chan string) {
+	h.mu.Lock()
+	if _, found := h.subs[ch]; found {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+func (h *logHub) Publish(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
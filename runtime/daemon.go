@@ -0,0 +1,13 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+package runtime
+
+// DaemonOpts configures how Daemonize backgrounds the current process.
+type DaemonOpts struct {
+	// RunPath is the directory Daemonize chdirs the detached process into.
+	RunPath string
+	// LogFile, if set, has fds 1 and 2 redirected into it instead of
+	// /dev/null.
+	LogFile string
+}
@@ -0,0 +1,155 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+//go:build !windows
+// +build !windows
+
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// daemonStageVar marks how far through the double-fork sequence the
+// current process is; it's unset in the original invocation.
+const daemonStageVar = "_GOLLY_DAEMON_STAGE"
+
+// Daemonize backgrounds the current process using the standard Unix
+// double-fork sequence: fork, ``setsid`` in the child, fork again so the
+// daemon can never reacquire a controlling terminal, ``umask(022)``, chdir
+// into opts.RunPath and redirect fds 0/1/2 to /dev/null (or opts.LogFile).
+//
+// Forking a multi-threaded Go runtime in place isn't supported, so each
+// stage below re-execs the current binary with an environment marker
+// rather than calling syscall.Fork directly. An inherited pipe on fd 3
+// threads success/failure back up the chain, so the original invocation
+// only returns control to its caller -- by exiting -- once the fully
+// detached grandchild has finished initialising.
+func Daemonize(opts DaemonOpts) error {
+	switch os.Getenv(daemonStageVar) {
+	case "":
+		return daemonLaunch(opts)
+	case "1":
+		return daemonFork2(opts)
+	case "2":
+		return daemonFinish(opts)
+	}
+	return fmt.Errorf("runtime: unknown daemon stage %q", os.Getenv(daemonStageVar))
+}
+
+// daemonLaunch re-execs the current process as stage 1 and blocks on the
+// synchronisation pipe until it learns whether the daemon made it up.
+func daemonLaunch(opts DaemonOpts) error {
+	read, write, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd := daemonRelaunch("1", write)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	write.Close()
+	reply, _ := bufio.NewReader(read).ReadString('\n')
+	read.Close()
+	cmd.Process.Release()
+	if reply != "ok\n" {
+		if reply == "" {
+			reply = "daemon exited before signalling readiness"
+		}
+		Error("Couldn't daemonize: %s", strings.TrimSuffix(reply, "\n"))
+	}
+	Exit(0)
+	return nil
+}
+
+// daemonFork2 is stage 1: it drops the process into its own session so it
+// has no controlling terminal, then forks again -- by re-exec'ing as stage
+// 2 and immediately exiting -- so the daemon can never reacquire one.
+func daemonFork2(opts DaemonOpts) error {
+	sync := os.NewFile(3, "daemon-sync")
+	if _, err := syscall.Setsid(); err != nil {
+		fmt.Fprintf(sync, "setsid: %s\n", err)
+		os.Exit(1)
+	}
+	cmd := daemonRelaunch("2", sync)
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(sync, "%s\n", err)
+		os.Exit(1)
+	}
+	cmd.Process.Release()
+	os.Exit(0)
+	return nil
+}
+
+// daemonFinish is stage 2: the fully detached grandchild. It finishes
+// setting up the process environment and signals the original invocation
+// via fd 3 before returning control to the caller.
+func daemonFinish(opts DaemonOpts) error {
+	sync := os.NewFile(3, "daemon-sync")
+	signal.Ignore(syscall.SIGHUP)
+	syscall.Umask(022)
+	runPath := opts.RunPath
+	if runPath == "" {
+		runPath = "/"
+	}
+	if err := os.Chdir(runPath); err != nil {
+		fmt.Fprintf(sync, "chdir %s: %s\n", runPath, err)
+		sync.Close()
+		os.Exit(1)
+	}
+	if err := redirectStdio(opts.LogFile); err != nil {
+		fmt.Fprintf(sync, "%s\n", err)
+		sync.Close()
+		os.Exit(1)
+	}
+	fmt.Fprint(sync, "ok\n")
+	sync.Close()
+	return nil
+}
+
+// redirectStdio closes fds 0/1/2 and reopens them against /dev/null, or
+// against logFile for stdout/stderr when one is given.
+func redirectStdio(logFile string) error {
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	if err := syscall.Dup2(int(devNull.Fd()), 0); err != nil {
+		return err
+	}
+	out := devNull
+	if logFile != "" {
+		out, err = os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	if err := syscall.Dup2(int(out.Fd()), 1); err != nil {
+		return err
+	}
+	return syscall.Dup2(int(out.Fd()), 2)
+}
+
+// daemonRelaunch re-execs the current binary with the given daemon stage
+// marker set, passing sync through as its inherited fd 3.
+func daemonRelaunch(stage string, sync *os.File) *exec.Cmd {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonStageVar+"="+stage)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{sync}
+	return cmd
+}
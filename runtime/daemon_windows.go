@@ -0,0 +1,14 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+//go:build windows
+// +build windows
+
+package runtime
+
+// Daemonize is a no-op on Windows, which has no notion of forking off a
+// detached Unix-style daemon -- services are expected to be managed by the
+// Windows Service Control Manager instead.
+func Daemonize(opts DaemonOpts) error {
+	return nil
+}
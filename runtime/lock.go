@@ -0,0 +1,108 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by TryLock when the named lock is already held,
+// whether by another process or by an earlier, unreleased TryLock in this one.
+var ErrLocked = errors.New("runtime: lock is held by another process")
+
+// Lock is an advisory, per-(directory, name) file lock backed by the OS's
+// native locking primitive -- flock on Unix, LockFileEx on Windows -- rather
+// than a hardlinked pid file. Stale-lock recovery comes for free, since the
+// kernel releases the lock the moment the owning process dies, whatever the
+// reason.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+func lockPath(directory, name string) string {
+	return filepath.Join(directory, name+".lock")
+}
+
+// TryLock attempts to acquire the named lock without blocking. It returns
+// ErrLocked if the lock is already held, including by this process.
+func TryLock(directory, name string) (*Lock, error) {
+	file, err := os.OpenFile(lockPath(directory, name), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Only write our pid in once the kernel lock is actually held, so that
+	// IsLocked never reports a pid that doesn't currently own the lock.
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	if err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+	lock := &Lock{path: file.Name(), file: file}
+	RegisterExitHandler(lock.Release)
+	return lock, nil
+}
+
+// AcquireLock acquires the named lock, blocking until it succeeds or ctx is
+// cancelled.
+func AcquireLock(ctx context.Context, directory, name string) (*Lock, error) {
+	for {
+		lock, err := TryLock(directory, name)
+		if err != ErrLocked {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// GetLock is kept as a backward-compatible alias for TryLock.
+func GetLock(directory, name string) (*Lock, error) {
+	return TryLock(directory, name)
+}
+
+// Release releases the lock, letting another process acquire it.
+func (lock *Lock) Release() {
+	unlockFile(lock.file)
+	lock.file.Close()
+}
+
+// ReleaseLock is kept as a backward-compatible alias for Release.
+func (lock *Lock) ReleaseLock() {
+	lock.Release()
+}
+
+// IsLocked reports whether the named lock is currently held by any process,
+// this one included, and, if so, the pid that holds it.
+func IsLocked(directory, name string) (pid int, ok bool) {
+	path := lockPath(directory, name)
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	if err := lockFile(file); err != nil {
+		data, _ := os.ReadFile(path)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		return pid, true
+	}
+	unlockFile(file)
+	return 0, false
+}
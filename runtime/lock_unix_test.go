@@ -0,0 +1,147 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+//go:build !windows
+// +build !windows
+
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFileExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	holder, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	defer holder.Close()
+
+	if err := lockFile(holder); err != nil {
+		t.Fatalf("lockFile on an uncontended file returned %s", err)
+	}
+
+	contender, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	defer contender.Close()
+
+	if err := lockFile(contender); err != ErrLocked {
+		t.Fatalf("lockFile on a held lock = %v, want ErrLocked", err)
+	}
+
+	if err := unlockFile(holder); err != nil {
+		t.Fatalf("unlockFile: %s", err)
+	}
+
+	if err := lockFile(contender); err != nil {
+		t.Fatalf("lockFile after release returned %s", err)
+	}
+	unlockFile(contender)
+}
+
+func TestTryLockContendsAndReleases(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := TryLock(dir, "test")
+	if err != nil {
+		t.Fatalf("TryLock: %s", err)
+	}
+
+	if _, err := TryLock(dir, "test"); err != ErrLocked {
+		t.Fatalf("second TryLock = %v, want ErrLocked", err)
+	}
+
+	lock.Release()
+
+	again, err := TryLock(dir, "test")
+	if err != nil {
+		t.Fatalf("TryLock after Release: %s", err)
+	}
+	again.Release()
+}
+
+func TestIsLocked(t *testing.T) {
+	dir := t.TempDir()
+
+	if pid, ok := IsLocked(dir, "test"); ok {
+		t.Fatalf("IsLocked on a non-existent lock = (%d, true), want false", pid)
+	}
+
+	lock, err := TryLock(dir, "test")
+	if err != nil {
+		t.Fatalf("TryLock: %s", err)
+	}
+
+	pid, ok := IsLocked(dir, "test")
+	if !ok {
+		t.Fatal("IsLocked on a held lock = false, want true")
+	}
+	if pid != os.Getpid() {
+		t.Errorf("IsLocked pid = %d, want %d", pid, os.Getpid())
+	}
+
+	lock.Release()
+
+	if _, ok := IsLocked(dir, "test"); ok {
+		t.Fatal("IsLocked after Release = true, want false")
+	}
+}
+
+func TestAcquireLockBlocksUntilReleased(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := TryLock(dir, "test")
+	if err != nil {
+		t.Fatalf("TryLock: %s", err)
+	}
+
+	acquired := make(chan *Lock, 1)
+	go func() {
+		l, err := AcquireLock(context.Background(), dir, "test")
+		if err != nil {
+			t.Errorf("AcquireLock: %s", err)
+			return
+		}
+		acquired <- l
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("AcquireLock returned before the held lock was released")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	lock.Release()
+
+	select {
+	case l := <-acquired:
+		l.Release()
+	case <-time.After(2 * time.Second):
+		t.Fatal("AcquireLock never returned after the lock was released")
+	}
+}
+
+func TestAcquireLockRespectsContextCancellation(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := TryLock(dir, "test")
+	if err != nil {
+		t.Fatalf("TryLock: %s", err)
+	}
+	defer lock.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := AcquireLock(ctx, dir, "test"); err != context.DeadlineExceeded {
+		t.Fatalf("AcquireLock = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Public Domain (-) 2010-2013 The Golly Authors.
+// See the Golly UNLICENSE file for details.
+
+//go:build windows
+// +build windows
+
+package runtime
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileExclusiveLock   = 0x00000002
+	lockfileFailImmediately = 0x00000001
+
+	// errorLockViolation is ERROR_LOCK_VIOLATION. It isn't exported by the
+	// standard syscall package on Windows, so we spell it out as the
+	// errno Windows actually returns.
+	errorLockViolation = syscall.Errno(0x21)
+)
+
+// lockFile takes an exclusive, non-blocking lock on file via LockFileEx,
+// returning ErrLocked if it's already held elsewhere.
+func lockFile(file *os.File) error {
+	var overlapped syscall.Overlapped
+	ret, _, err := procLockFileEx.Call(
+		file.Fd(),
+		uintptr(lockfileExclusiveLock|lockfileFailImmediately),
+		0,
+		1, 0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ret == 0 {
+		if err == errorLockViolation {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// unlockFile releases a lock previously taken by lockFile.
+func unlockFile(file *os.File) error {
+	var overlapped syscall.Overlapped
+	ret, _, err := procUnlockFileEx.Call(
+		file.Fd(),
+		0,
+		1, 0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
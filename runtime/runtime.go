@@ -7,18 +7,16 @@ package runtime
 
 import (
 	"fmt"
-	"github.com/tav/golly/command"
 	"github.com/tav/golly/log"
 	"github.com/tav/golly/optparse"
 	"net"
 	"os"
 	"os/signal"
-	"path"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const Platform = runtime.GOOS
@@ -63,11 +61,19 @@ func Exit(code int) {
 
 func Error(format string, v ...interface{}) {
 	log.Error(format, v...)
+	logBroadcast.Publish(fmt.Sprintf(format, v...))
+	// Give any /tail subscriber a chance to receive and flush the line above
+	// before Exit's os.Exit tears the process down -- mirrors handleHalt's
+	// grace period in runtime/control.go, and for the same reason.
+	time.Sleep(100 * time.Millisecond)
 	Exit(1)
 }
 
 func StandardError(err error) {
 	log.StandardError(err)
+	logBroadcast.Publish(err.Error())
+	// See the comment in Error above.
+	time.Sleep(100 * time.Millisecond)
 	Exit(1)
 }
 
@@ -83,38 +89,6 @@ func CreatePidFile(path string) {
 	}
 }
 
-type Lock struct {
-	link     string
-	file     string
-	acquired bool
-}
-
-func GetLock(directory string, name string) (lock *Lock, err error) {
-	file := path.Join(directory, fmt.Sprintf("%s-%d.lock", name, os.Getpid()))
-	lockFile, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		return
-	}
-	lockFile.Close()
-	link := path.Join(directory, name+".lock")
-	err = os.Link(file, link)
-	if err == nil {
-		lock = &Lock{
-			link: link,
-			file: file,
-		}
-		RegisterExitHandler(func() { lock.ReleaseLock() })
-	} else {
-		os.Remove(file)
-	}
-	return
-}
-
-func (lock *Lock) ReleaseLock() {
-	os.Remove(lock.file)
-	os.Remove(lock.link)
-}
-
 // JoinPath joins the given path with the directory unless it happens to be an
 // absolute path, in which case it returns the path exactly as it was given.
 func JoinPath(directory, path string) string {
@@ -133,15 +107,18 @@ func Init() {
 // process.
 func InitProcess(name, runPath string) {
 
-	// Get the runtime lock to ensure we only have one process of any given name
-	// running within the same run path at any time.
-	_, err := GetLock(runPath, name)
+	// Acquire the runtime lock to ensure we only have one process of any
+	// given name running within the same run path at any time. This
+	// registers the lock's release as an exit handler immediately on
+	// success, so do this before writing the pid file below rather than
+	// racing the two against each other in separate goroutines.
+	_, err := TryLock(runPath, name)
 	if err != nil {
 		Error("Couldn't successfully acquire a process lock:\n\n\t%s\n", err)
 	}
 
 	// Write the process ID into a file for use by external scripts.
-	go CreatePidFile(filepath.Join(runPath, name+".pid"))
+	CreatePidFile(filepath.Join(runPath, name+".pid"))
 
 }
 
@@ -175,6 +152,18 @@ func DefaultOpts(name string, opts *optparse.Parser, argv []string, autoExit boo
 	extraConfig := opts.StringConfig("extra-config", "",
 		"path to a YAML config file with additional options")
 
+	controlAddr := opts.StringConfig("control-addr", "",
+		"address to bind an HTTP control server to, e.g. localhost:9999 [disabled]")
+
+	controlSecret := opts.StringConfig("control-secret", "",
+		"shared-secret bearer token required to access the control server")
+
+	daemon := opts.Bool([]string{"-D", "--daemon"},
+		"daemonize the process, detaching it from the controlling terminal")
+
+	foreground := opts.Bool([]string{"--foreground"},
+		"skip daemonization but still write the pid file, e.g. for systemd/runit [false]")
+
 	// Parse the command line options.
 	args := opts.Parse(argv)
 
@@ -247,6 +236,15 @@ func DefaultOpts(name string, opts *optparse.Parser, argv []string, autoExit boo
 		StandardError(err)
 	}
 
+	// Daemonize before opening any log files, so that the fully-detached
+	// daemon is the one that ends up owning them. InitProcess's pid file is
+	// still written afterwards, whichever path is taken.
+	if *daemon && !*foreground && Platform != "windows" {
+		if err := Daemonize(DaemonOpts{RunPath: runPath, LogFile: filepath.Join(logPath, name+".daemon.log")}); err != nil {
+			Error("Couldn't daemonize %q: %s", name, err)
+		}
+	}
+
 	// Setup the file and console logging.
 	var rotate int
 
@@ -280,66 +278,99 @@ func DefaultOpts(name string, opts *optparse.Parser, argv []string, autoExit boo
 		InitProcess(name, runPath)
 	}
 
+	// Start the control server if an address was configured, so that the
+	// process can be operated remotely without SSH access to the host.
+	if *controlAddr != "" {
+		NewControlServer(*controlAddr, *controlSecret).Serve()
+	}
+
 	return *debug, instanceDirectory, runPath, logPath, false
 
 }
 
 // GetCPUCount tries to detect the number of CPUs on the current machine.
 func GetCPUCount() (count int) {
-	// On BSD systems, it should be possible to use ``sysctl -n hw.ncpu`` to
-	// figure this out.
-	if (Platform == "darwin") || (Platform == "freebsd") {
-		output, err := command.GetOutput(
-			[]string{"/usr/sbin/sysctl", "-n", "hw.ncpu"},
-		)
-		if err != nil {
-			return 1
-		}
-		count, err = strconv.Atoi(strings.TrimSpace(output))
-		if err != nil {
-			return 1
+	// runtime.NumCPU() already does the platform-specific detection for us,
+	// so there's no need to shell out to ``sysctl`` or parse
+	// ``/proc/cpuinfo`` on every process start.
+	if count = runtime.NumCPU(); count > 0 {
+		return count
+	}
+	// For unknown platforms, we assume that there's just a single processor.
+	return 1
+}
+
+// interfaceIPs returns the global-scope addresses of every up, non-loopback
+// network interface on the machine: IPv4 addresses only, or IPv6 addresses
+// only when ipv6 is set.
+func interfaceIPs(ipv6 bool) ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
 		}
-		// Linux systems provide introspection via ``/proc/cpuinfo``.
-	} else if Platform == "linux" {
-		output, err := command.GetOutput([]string{"/bin/cat", "/proc/cpuinfo"})
+		addrs, err := iface.Addrs()
 		if err != nil {
-			return 1
+			continue
 		}
-		for _, line := range strings.Split(output, "\n") {
-			if strings.HasPrefix(line, "processor") {
-				count += 1
+		for _, addr := range addrs {
+			var ip net.IP
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			default:
+				continue
+			}
+			if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				continue
+			}
+			if (ip.To4() != nil) == ipv6 {
+				continue
 			}
+			ips = append(ips, ip)
 		}
 	}
-	// For unknown platforms, we assume that there's just a single processor.
-	if count == 0 {
-		return 1
-	}
-	return count
+	return ips, nil
 }
 
-// GetIP tries to determine the IP address of the current machine.
+// GetIP tries to determine the primary IPv4 address of the current machine
+// by walking its network interfaces, rather than resolving its hostname via
+// DNS -- which is slow and often wrong on multi-homed or NAT'd boxes.
 func GetIP() string {
-	hostname, err := os.Hostname()
+	ips, err := interfaceIPs(false)
 	if err != nil {
 		StandardError(err)
 	}
-	addrs, err := net.LookupHost(hostname)
+	if len(ips) == 0 {
+		Error("Couldn't determine local IP address")
+	}
+	return ips[0].String()
+}
+
+// GetIPIn returns the machine's IP address that falls within the given
+// CIDR, e.g. "10.0.0.0/8" for VPC or overlay-network deployments where
+// GetIP's "first global address" heuristic would pick the wrong interface.
+func GetIPIn(cidr string) (net.IP, error) {
+	_, network, err := net.ParseCIDR(cidr)
 	if err != nil {
-		StandardError(err)
+		return nil, err
 	}
-	var ip string
-	for _, addr := range addrs {
-		if strings.Contains(addr, ":") || strings.HasPrefix(addr, "127.") {
-			continue
-		}
-		ip = addr
-		break
+	ips, err := interfaceIPs(network.IP.To4() == nil)
+	if err != nil {
+		return nil, err
 	}
-	if ip == "" {
-		Error("Couldn't determine local IP address")
+	for _, ip := range ips {
+		if network.Contains(ip) {
+			return ip, nil
+		}
 	}
-	return ip
+	return nil, fmt.Errorf("runtime: no interface address found within %s", cidr)
 }
 
 // GetAddr returns host:port and fills in empty host parameter with the current
@@ -362,6 +393,28 @@ func GetAddrListener(host string, port int) (string, net.Listener) {
 	return addr, listener
 }
 
+// GetAddrListener6 behaves like GetAddrListener, but determines the
+// machine's global IPv6 address when host is empty, for networks where
+// only an IPv6 address is available.
+func GetAddrListener6(host string, port int) (string, net.Listener) {
+	if host == "" {
+		ips, err := interfaceIPs(true)
+		if err != nil {
+			StandardError(err)
+		}
+		if len(ips) == 0 {
+			Error("Couldn't determine local IPv6 address")
+		}
+		host = ips[0].String()
+	}
+	addr := fmt.Sprintf("[%s]:%d", host, port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		Error("Cannot listen on %s: %v", addr, err)
+	}
+	return addr, listener
+}
+
 func init() {
 
 	// Set the ``runtime.CPUCount`` variable to the number of CPUs detected.